@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/cloudflare/cfssl/log"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	reapTimestampAnnotation = "pod-reaper/reap-timestamp"
+	reapReasonAnnotation    = "pod-reaper/reason"
+	reapPolicyAnnotation    = "pod-reaper/policy"
+
+	// reasonLifetimeExpired marks a pod reaped because it outlived its
+	// pod.kubernetes.io/lifetime annotation.
+	reasonLifetimeExpired = "lifetime-expired"
+	// reasonEvictedCleanup marks a pod reaped because it was already sitting
+	// in an Evicted state.
+	reasonEvictedCleanup = "evicted-cleanup"
+	// reasonNodeDrain marks a pod reaped because its node was being drained
+	// ahead of cordon/termination.
+	reasonNodeDrain = "node-drain"
+	// reasonReaperPolicy marks a pod reaped because a ReaperPolicy's
+	// selector and schedule matched it.
+	reasonReaperPolicy = "reaper-policy"
+)
+
+// markDisruptionTarget records why pod-reaper is about to disrupt a pod
+// before doing so, matching upstream Kubernetes' own DisruptionTarget
+// condition so downstream audit tooling and controllers (Job/Deployment
+// retry logic) get a machine-readable trail instead of a pod silently
+// disappearing. Failures are logged and otherwise ignored: a missed
+// annotation should never block the actual reap.
+func markDisruptionTarget(clientset *kubernetes.Clientset, pod v1.Pod, reason string, policyName string) {
+	annotations := map[string]string{
+		reapTimestampAnnotation: time.Now().UTC().Format(time.RFC3339),
+		reapReasonAnnotation:    reason,
+	}
+	if policyName != "" {
+		annotations[reapPolicyAnnotation] = policyName
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": annotations,
+		},
+	})
+	if err != nil {
+		log.Errorf("pod %s : failed to build disruption annotation patch: %s\n", pod.Name, err.Error())
+	} else if patched, err := clientset.CoreV1().Pods(pod.Namespace).Patch(context.TODO(), pod.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		log.Errorf("pod %s : failed to annotate before reaping: %s\n", pod.Name, err.Error())
+	} else {
+		pod = *patched
+	}
+
+	condition := v1.PodCondition{
+		Type:               v1.DisruptionTarget,
+		Status:             v1.ConditionTrue,
+		Reason:             "EvictionByPodReaper",
+		Message:            fmt.Sprintf("pod-reaper is reaping this pod: %s", reason),
+		LastTransitionTime: metav1.Now(),
+	}
+
+	// A pod can be reconciled more than once before it's actually removed
+	// (PDB-blocked drain retries, repeated ReaperPolicy reconciles), so
+	// update the existing DisruptionTarget condition in place rather than
+	// appending and accumulating duplicates.
+	replaced := false
+	for i := range pod.Status.Conditions {
+		if pod.Status.Conditions[i].Type == v1.DisruptionTarget {
+			pod.Status.Conditions[i] = condition
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		pod.Status.Conditions = append(pod.Status.Conditions, condition)
+	}
+
+	if _, err := clientset.CoreV1().Pods(pod.Namespace).UpdateStatus(context.TODO(), &pod, metav1.UpdateOptions{}); err != nil {
+		log.Errorf("pod %s : failed to set DisruptionTarget condition: %s\n", pod.Name, err.Error())
+	}
+}
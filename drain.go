@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cfssl/log"
+	"github.com/prometheus/client_golang/prometheus"
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var metricDrainOutcome = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "pod_reaper_drain_outcome",
+		Help: "Number of pods processed by the PDB-aware drain routine, by outcome.",
+	},
+	[]string{
+		"namespace",
+		"outcome",
+	},
+)
+
+func podDrainTimeout() time.Duration {
+	i, err := strconv.Atoi(os.Getenv("POD_DRAIN_TIMEOUT"))
+	if err != nil {
+		i = 30
+	}
+	return time.Duration(i) * time.Second
+}
+
+func forceDeleteOnTimeout() bool {
+	if val, ok := os.LookupEnv("FORCE_DELETE_ON_TIMEOUT"); ok {
+		boolVal, err := strconv.ParseBool(val)
+		if err == nil {
+			return boolVal
+		}
+	}
+	return false
+}
+
+func ignoreDaemonSets() bool {
+	if val, ok := os.LookupEnv("IGNORE_DAEMONSETS"); ok {
+		boolVal, err := strconv.ParseBool(val)
+		if err == nil {
+			return boolVal
+		}
+	}
+	return false
+}
+
+func skipLocalStorage() bool {
+	if val, ok := os.LookupEnv("SKIP_LOCAL_STORAGE"); ok {
+		boolVal, err := strconv.ParseBool(val)
+		if err == nil {
+			return boolVal
+		}
+	}
+	return false
+}
+
+func podDrainConcurrency() int {
+	i, err := strconv.Atoi(os.Getenv("MAX_PODS_DRAIN_PARALLEL"))
+	if err != nil || i <= 0 {
+		i = 5
+	}
+	return i
+}
+
+// isMirrorPod reports whether the pod is a static pod mirror, which cannot
+// be evicted or deleted through the API server.
+func isMirrorPod(pod v1.Pod) bool {
+	_, ok := pod.Annotations["kubernetes.io/config.mirror"]
+	return ok
+}
+
+// isDaemonSetPod reports whether the pod is owned by a DaemonSet.
+func isDaemonSetPod(pod v1.Pod) bool {
+	for _, ref := range pod.OwnerReferences {
+		if ref.Kind == "DaemonSet" {
+			return true
+		}
+	}
+	return false
+}
+
+// hasLocalStorage reports whether the pod mounts an emptyDir volume, which
+// is lost when the pod is drained off the node.
+func hasLocalStorage(pod v1.Pod) bool {
+	for _, vol := range pod.Spec.Volumes {
+		if vol.EmptyDir != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// drainSkipReason reports whether pod should be skipped by the PDB-aware
+// drain routine rather than evicted - mirror pods can never be evicted
+// through the API server, DaemonSet pods are skipped unless
+// IGNORE_DAEMONSETS is set, and pods with local storage are skipped when
+// SKIP_LOCAL_STORAGE is set. It is shared by drainPods and the informer
+// reconciler so both paths apply the same filters.
+func drainSkipReason(pod v1.Pod) (string, bool) {
+	if isMirrorPod(pod) {
+		return "mirror pod", true
+	}
+	if isDaemonSetPod(pod) && !ignoreDaemonSets() {
+		return "DaemonSet pod", true
+	}
+	if skipLocalStorage() && hasLocalStorage(pod) {
+		return "has local storage", true
+	}
+	return "", false
+}
+
+// drainPods runs drainPod for each pod with bounded concurrency, mirroring
+// kubectl drain's --max-concurrency flag, and reports the outcome of every
+// pod via metricDrainOutcome.
+func drainPods(clientset *kubernetes.Clientset, pods []v1.Pod, reason string, policyName string) int {
+	sem := make(chan struct{}, podDrainConcurrency())
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	killed := 0
+
+	for _, pod := range pods {
+		pod := pod
+		if skipReason, skip := drainSkipReason(pod); skip {
+			log.Debugf("pod %s : %s, skipping\n", pod.Name, skipReason)
+			metricDrainOutcome.WithLabelValues(pod.Namespace, "skipped").Inc()
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			outcome := drainPod(clientset, pod, reason, policyName)
+			metricDrainOutcome.WithLabelValues(pod.Namespace, outcome).Inc()
+			if outcome == "evicted" || outcome == "deleted" {
+				mu.Lock()
+				killed++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	return killed
+}
+
+// drainPod evicts a single pod, respecting any PodDisruptionBudget that
+// covers it. Eviction requests that are blocked by a PDB come back as a 429
+// (TooManyRequests); those are retried with backoff until POD_DRAIN_TIMEOUT
+// elapses, at which point the pod falls back to a forced Delete if
+// FORCE_DELETE_ON_TIMEOUT is set.
+func drainPod(clientset *kubernetes.Clientset, pod v1.Pod, reason string, policyName string) string {
+	markDisruptionTarget(clientset, pod, reason, policyName)
+
+	deadline := time.Now().Add(podDrainTimeout())
+	backoff := time.Second
+
+	for {
+		err := clientset.CoreV1().Pods(pod.Namespace).EvictV1(context.TODO(), &policyv1.Eviction{
+			ObjectMeta:    metav1.ObjectMeta{Namespace: pod.Namespace, Name: pod.Name},
+			DeleteOptions: &metav1.DeleteOptions{},
+		})
+		if err == nil {
+			log.Infof("pod %s : evicted\n", pod.Name)
+			return "evicted"
+		}
+
+		if apierrors.IsTooManyRequests(err) {
+			log.Debugf("pod %s : eviction blocked by PodDisruptionBudget, retrying in %s\n", pod.Name, backoff)
+			if time.Now().Add(backoff).After(deadline) {
+				log.Infof("pod %s : eviction timed out waiting on PodDisruptionBudget\n", pod.Name)
+				if forceDeleteOnTimeout() {
+					return forceDeletePod(clientset, pod)
+				}
+				return "pdb_blocked"
+			}
+			time.Sleep(backoff)
+			backoff *= 2
+			continue
+		}
+
+		log.Infof("pod %s : eviction failed: %s\n", pod.Name, err.Error())
+		if time.Now().After(deadline) {
+			if forceDeleteOnTimeout() {
+				return forceDeletePod(clientset, pod)
+			}
+			return "timeout"
+		}
+		time.Sleep(backoff)
+	}
+}
+
+// forceDeletePod deletes a pod immediately, bypassing graceful termination.
+// It is only used once eviction has been retried until POD_DRAIN_TIMEOUT.
+func forceDeletePod(clientset *kubernetes.Clientset, pod v1.Pod) string {
+	grace := int64(0)
+	err := clientset.CoreV1().Pods(pod.Namespace).Delete(context.TODO(), pod.Name, metav1.DeleteOptions{GracePeriodSeconds: &grace})
+	if err != nil {
+		log.Infof("pod %s : force delete failed: %s\n", pod.Name, err.Error())
+		return "error"
+	}
+	log.Infof("pod %s : force deleted after eviction timeout\n", pod.Name)
+	return "deleted"
+}
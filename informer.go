@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/cfssl/log"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// tokenBucket caps the rate of reaps per second. It replaces
+// MAX_REAPER_COUNT_PER_RUN's old role of bounding a single List response: in
+// the informer model there is no "run" to bound, only a continuous stream of
+// pods becoming due, so the same env var now sizes a bucket refilled once a
+// second.
+type tokenBucket struct {
+	tokens chan struct{}
+}
+
+func newTokenBucket(rate int) *tokenBucket {
+	if rate <= 0 {
+		rate = 1
+	}
+	tb := &tokenBucket{tokens: make(chan struct{}, rate)}
+	for i := 0; i < rate; i++ {
+		tb.tokens <- struct{}{}
+	}
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			for i := 0; i < rate; i++ {
+				select {
+				case tb.tokens <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return tb
+}
+
+func (tb *tokenBucket) take() {
+	<-tb.tokens
+}
+
+func matchesNamespace(ns string, allowed []string) bool {
+	for _, a := range allowed {
+		if a == metav1.NamespaceAll || a == ns {
+			return true
+		}
+	}
+	return false
+}
+
+// PodController watches pods cluster-wide and schedules each tracked pod for
+// re-evaluation at exactly creationTime+lifetime, instead of relisting every
+// pod in the namespace on a fixed interval.
+type PodController struct {
+	clientset   *kubernetes.Clientset
+	informer    cache.SharedIndexInformer
+	queue       workqueue.RateLimitingInterface
+	namespaces  []string
+	evict       bool
+	reapEvicted bool
+	limiter     *tokenBucket
+}
+
+func newPodController(clientset *kubernetes.Clientset, namespaces []string, evict bool, reapEvicted bool, maxReaperRate int) *PodController {
+	factory := informers.NewSharedInformerFactory(clientset, sleepDuration())
+	informer := factory.Core().V1().Pods().Informer()
+
+	pc := &PodController{
+		clientset:   clientset,
+		informer:    informer,
+		queue:       workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		namespaces:  namespaces,
+		evict:       evict,
+		reapEvicted: reapEvicted,
+		limiter:     newTokenBucket(maxReaperRate),
+	}
+
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			pc.enqueue(obj)
+			pc.refreshMetrics()
+		},
+		UpdateFunc: func(_, newObj interface{}) {
+			pc.enqueue(newObj)
+			pc.refreshMetrics()
+		},
+		DeleteFunc: func(interface{}) { pc.refreshMetrics() },
+	})
+
+	return pc
+}
+
+func (pc *PodController) enqueue(obj interface{}) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok || !matchesNamespace(pod.Namespace, pc.namespaces) {
+		return
+	}
+
+	key, err := cache.MetaNamespaceKeyFunc(pod)
+	if err != nil {
+		return
+	}
+
+	if _, ok := pod.Annotations[preventReapAnnotation()]; ok {
+		return
+	}
+
+	if pc.reapEvicted && strings.Contains(pod.Status.Reason, "Evicted") {
+		pc.queue.Add(key)
+		return
+	}
+
+	val, ok := pod.Annotations[lifetimeAnnotation]
+	if !ok {
+		return
+	}
+	lifetime, err := time.ParseDuration(val)
+	if err != nil || lifetime == 0 {
+		log.Debugf("pod %s : provided value %s is incorrect\n", pod.Name, val)
+		return
+	}
+
+	pc.queue.AddAfter(key, time.Until(pod.CreationTimestamp.Time.Add(lifetime)))
+}
+
+// refreshMetrics recomputes the tracking/ignoring gauges from the informer's
+// local cache, so they stay accurate without ever listing the API server.
+func (pc *PodController) refreshMetrics() {
+	tracking := map[string]int{}
+	total := map[string]int{}
+	for _, obj := range pc.informer.GetStore().List() {
+		pod, ok := obj.(*v1.Pod)
+		if !ok || !matchesNamespace(pod.Namespace, pc.namespaces) {
+			continue
+		}
+		total[pod.Namespace]++
+		if _, ok := pod.Annotations[lifetimeAnnotation]; ok {
+			tracking[pod.Namespace]++
+		}
+	}
+	for ns, t := range total {
+		metricPods.WithLabelValues(ns, "tracking").Set(float64(tracking[ns]))
+		metricPods.WithLabelValues(ns, "ignoring").Set(float64(t - tracking[ns]))
+	}
+}
+
+func (pc *PodController) Run(ctx context.Context) {
+	defer pc.queue.ShutDown()
+
+	go pc.informer.Run(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), pc.informer.HasSynced) {
+		log.Errorf("pod informer cache failed to sync")
+		return
+	}
+
+	// reconcile calls drainPod synchronously, which can block for up to
+	// POD_DRAIN_TIMEOUT waiting on a PDB, so a single worker would let one
+	// PDB-blocked pod stall reaping of every other due pod. Run as many
+	// workers as pods are allowed to drain in parallel.
+	for i := 0; i < podDrainConcurrency(); i++ {
+		go wait.Until(pc.runWorker, time.Second, ctx.Done())
+	}
+	<-ctx.Done()
+}
+
+func (pc *PodController) runWorker() {
+	for pc.processNextItem() {
+	}
+}
+
+func (pc *PodController) processNextItem() bool {
+	key, shutdown := pc.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer pc.queue.Done(key)
+
+	pc.limiter.take()
+
+	if err := pc.reconcile(key.(string)); err != nil {
+		log.Infof("pod %s : unable to reap pod : %s", key, err.Error())
+		pc.queue.AddRateLimited(key)
+		return true
+	}
+	pc.queue.Forget(key)
+	return true
+}
+
+func (pc *PodController) reconcile(key string) error {
+	obj, exists, err := pc.informer.GetIndexer().GetByKey(key)
+	if err != nil || !exists {
+		return nil
+	}
+	pod := obj.(*v1.Pod).DeepCopy()
+
+	if _, ok := pod.Annotations[preventReapAnnotation()]; ok {
+		log.Debugf("pod %s : has %s annotation, skipping\n", pod.Name, preventReapAnnotation())
+		metricPodsReaped.WithLabelValues(pod.Namespace, "skipped: prevent-reap").Inc()
+		return nil
+	}
+
+	if pc.reapEvicted && strings.Contains(pod.Status.Reason, "Evicted") {
+		markDisruptionTarget(pc.clientset, *pod, reasonEvictedCleanup, "")
+		if err := pc.clientset.CoreV1().Pods(pod.Namespace).Delete(context.TODO(), pod.Name, metav1.DeleteOptions{}); err != nil {
+			return err
+		}
+		log.Infof("pod %s : pod killed.\n", pod.Name)
+		metricPodsReaped.WithLabelValues(pod.Namespace, "killed").Inc()
+		return nil
+	}
+
+	val, ok := pod.Annotations[lifetimeAnnotation]
+	if !ok {
+		return nil
+	}
+	lifetime, err := time.ParseDuration(val)
+	if err != nil || lifetime == 0 {
+		return nil
+	}
+
+	if remaining := time.Until(pod.CreationTimestamp.Time.Add(lifetime)); remaining > 0 {
+		pc.queue.AddAfter(key, remaining)
+		return nil
+	}
+
+	var outcome string
+	if pc.evict {
+		if skipReason, skip := drainSkipReason(*pod); skip {
+			log.Debugf("pod %s : %s, skipping\n", pod.Name, skipReason)
+			outcome = "skipped"
+		} else {
+			outcome = drainPod(pc.clientset, *pod, reasonLifetimeExpired, "")
+		}
+		metricDrainOutcome.WithLabelValues(pod.Namespace, outcome).Inc()
+	} else {
+		markDisruptionTarget(pc.clientset, *pod, reasonLifetimeExpired, "")
+		if err := pc.clientset.CoreV1().Pods(pod.Namespace).Delete(context.TODO(), pod.Name, metav1.DeleteOptions{}); err != nil {
+			return err
+		}
+		outcome = "deleted"
+	}
+
+	if outcome == "evicted" || outcome == "deleted" {
+		log.Infof("pod %s : pod reaped.\n", pod.Name)
+		metricPodsReaped.WithLabelValues(pod.Namespace, "killed").Inc()
+	} else if outcome != "skipped" {
+		// pdb_blocked, timeout, and error are non-terminal: drainPod only
+		// retries internally for POD_DRAIN_TIMEOUT, so the reconciler needs
+		// to pick the pod back up on the queue's backoff schedule instead
+		// of dropping it after a single attempt.
+		return fmt.Errorf("pod %s : drain did not complete (outcome=%s), will retry", pod.Name, outcome)
+	}
+	return nil
+}
+
+// NodeController watches nodes cluster-wide and re-runs reapNodes whenever
+// the node set changes, instead of polling on a fixed interval.
+type NodeController struct {
+	clientset *kubernetes.Clientset
+	informer  cache.SharedIndexInformer
+	trigger   chan struct{}
+}
+
+func newNodeController(clientset *kubernetes.Clientset) *NodeController {
+	factory := informers.NewSharedInformerFactory(clientset, sleepDuration())
+	informer := factory.Core().V1().Nodes().Informer()
+
+	nc := &NodeController{
+		clientset: clientset,
+		informer:  informer,
+		trigger:   make(chan struct{}, 1),
+	}
+
+	notify := func(interface{}) { nc.notify() }
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    notify,
+		UpdateFunc: func(_, newObj interface{}) { notify(newObj) },
+		DeleteFunc: notify,
+	})
+
+	return nc
+}
+
+func (nc *NodeController) notify() {
+	select {
+	case nc.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (nc *NodeController) Run(ctx context.Context) {
+	go nc.informer.Run(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), nc.informer.HasSynced) {
+		log.Errorf("node informer cache failed to sync")
+		return
+	}
+
+	nc.notify()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-nc.trigger:
+			reapNodes(nc.clientset)
+		}
+	}
+}
+
+// runReconcilers replaces the polling loop with a pod and a node informer,
+// each scheduling work off the watch stream instead of a full List every
+// REAPER_INTERVAL_IN_SEC. It blocks until ctx is cancelled.
+func runReconcilers(ctx context.Context, config *rest.Config, clientset *kubernetes.Clientset, namespaces []string, maxReaperRate int, evict bool, reapEvicted bool) {
+	if len(namespaces) == 0 {
+		log.Infof("No namespaces to monitor")
+		<-ctx.Done()
+		return
+	}
+
+	pc := newPodController(clientset, namespaces, evict, reapEvicted, maxReaperRate)
+	nc := newNodeController(clientset)
+
+	go pc.Run(ctx)
+
+	if reaperPolicyEnabled() {
+		dynamicClient, err := dynamic.NewForConfig(config)
+		if err != nil {
+			log.Errorf("reaperpolicy : failed to build dynamic client, policies disabled: %s\n", err.Error())
+		} else {
+			rc := newReaperPolicyController(clientset, dynamicClient, sleepDuration())
+			go rc.Run(ctx)
+		}
+	}
+
+	nc.Run(ctx)
+}
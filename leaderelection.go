@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudflare/cfssl/log"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// isLeader tracks whether this replica currently holds the lease. It is only
+// ever meaningful when leaderElectEnabled() is true; otherwise every replica
+// is considered the leader.
+var isLeader int32
+
+func leaderElectEnabled() bool {
+	if val, ok := os.LookupEnv("LEADER_ELECT"); ok {
+		boolVal, err := strconv.ParseBool(val)
+		if err == nil {
+			return boolVal
+		}
+	}
+	return false
+}
+
+func leaderElectNamespace() string {
+	if ns := os.Getenv("LEADER_ELECT_NAMESPACE"); ns != "" {
+		return ns
+	}
+	return "default"
+}
+
+func leaderElectName() string {
+	if name := os.Getenv("LEADER_ELECT_NAME"); name != "" {
+		return name
+	}
+	return "pod-reaper"
+}
+
+func leaderElectLeaseDuration() time.Duration {
+	i, err := strconv.Atoi(os.Getenv("LEADER_ELECT_LEASE_DURATION_SEC"))
+	if err != nil {
+		i = 15
+	}
+	return time.Duration(i) * time.Second
+}
+
+func leaderElectRenewDeadline() time.Duration {
+	i, err := strconv.Atoi(os.Getenv("LEADER_ELECT_RENEW_DEADLINE_SEC"))
+	if err != nil {
+		i = 10
+	}
+	return time.Duration(i) * time.Second
+}
+
+func leaderElectRetryPeriod() time.Duration {
+	i, err := strconv.Atoi(os.Getenv("LEADER_ELECT_RETRY_PERIOD_SEC"))
+	if err != nil {
+		i = 2
+	}
+	return time.Duration(i) * time.Second
+}
+
+// amLeader reports whether this replica is allowed to reap. When leader
+// election is disabled every replica is its own leader.
+func amLeader() bool {
+	if !leaderElectEnabled() {
+		return true
+	}
+	return atomic.LoadInt32(&isLeader) == 1
+}
+
+func leaseLock(clientset *kubernetes.Clientset, identity string) *resourcelock.LeaseLock {
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: coordinationv1.Lease{}.ObjectMeta,
+		Client:    clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: identity,
+		},
+	}
+	lock.LeaseMeta.Namespace = leaderElectNamespace()
+	lock.LeaseMeta.Name = leaderElectName()
+	return lock
+}
+
+// runLeaderElection blocks forever, calling run every time this replica is
+// elected leader. Standbys keep serving /metrics and the readiness probe
+// while they wait their turn. Intended for the long-running reconciler
+// path; a CronJob pass should use runLeaderElectionOnce instead, since it
+// must return once its single pass is done, not contend for the lease
+// forever.
+func runLeaderElection(clientset *kubernetes.Clientset, identity string, run func(ctx context.Context)) {
+	lock := leaseLock(clientset, identity)
+
+	// RunOrDie returns as soon as this replica stops holding the lease (a
+	// routine event: a GC pause, a slow apiserver, a lease handoff), not
+	// only when told to stop. Loop so losing leadership demotes to standby
+	// and retries acquisition instead of exiting the process.
+	for {
+		leaderelection.RunOrDie(context.Background(), leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			ReleaseOnCancel: true,
+			LeaseDuration:   leaderElectLeaseDuration(),
+			RenewDeadline:   leaderElectRenewDeadline(),
+			RetryPeriod:     leaderElectRetryPeriod(),
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					log.Infof("%s : acquired leader lease, starting reap loop\n", identity)
+					atomic.StoreInt32(&isLeader, 1)
+					run(ctx)
+				},
+				OnStoppedLeading: func() {
+					atomic.StoreInt32(&isLeader, 0)
+					log.Infof("%s : lost leader lease\n", identity)
+				},
+				OnNewLeader: func(currentLeader string) {
+					if currentLeader != identity {
+						log.Infof("%s : new leader elected: %s\n", identity, currentLeader)
+					}
+				},
+			},
+		})
+	}
+}
+
+// runLeaderElectionOnce blocks until it acquires the lease (retrying every
+// RetryPeriod while another replica holds it), calls run once, then
+// releases the lease and returns. Unlike runLeaderElection's infinite
+// loop, it does not contend for the lease again after its single pass, so
+// a CronJob pod can exit.
+func runLeaderElectionOnce(clientset *kubernetes.Clientset, identity string, run func(ctx context.Context)) {
+	lock := leaseLock(clientset, identity)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		ReleaseOnCancel: true,
+		LeaseDuration:   leaderElectLeaseDuration(),
+		RenewDeadline:   leaderElectRenewDeadline(),
+		RetryPeriod:     leaderElectRetryPeriod(),
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				log.Infof("%s : acquired leader lease, running this pass\n", identity)
+				atomic.StoreInt32(&isLeader, 1)
+				run(ctx)
+				cancel()
+			},
+			OnStoppedLeading: func() {
+				atomic.StoreInt32(&isLeader, 0)
+				log.Infof("%s : lost leader lease\n", identity)
+			},
+			OnNewLeader: func(currentLeader string) {
+				if currentLeader != identity {
+					log.Infof("%s : new leader elected: %s\n", identity, currentLeader)
+				}
+			},
+		},
+	})
+	if err != nil {
+		log.Errorf("%s : failed to create leader elector: %s\n", identity, err.Error())
+		return
+	}
+	elector.Run(ctx)
+}
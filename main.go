@@ -15,8 +15,6 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	v1 "k8s.io/api/core/v1"
-
-	policyv1 "k8s.io/api/policy/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
@@ -29,6 +27,17 @@ const (
 	lifetimeAnnotation string = "pod.kubernetes.io/lifetime"
 )
 
+// preventReapAnnotation returns the annotation key that, when present on a
+// pod with any value, unconditionally opts that pod out of reaping. This is
+// a break-glass escape hatch for on-callers who need to pin a debug pod
+// without touching its lifetime annotation or scaling the reaper down.
+func preventReapAnnotation() string {
+	if key := os.Getenv("PREVENT_REAP_ANNOTATION"); key != "" {
+		return key
+	}
+	return "pod.kubernetes.io/prevent-reap"
+}
+
 var (
 	metricPodsReaped = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
@@ -118,11 +127,24 @@ func main() {
 	// register metrics
 	prometheus.MustRegister(metricPods)
 	prometheus.MustRegister(metricPodsReaped)
+	prometheus.MustRegister(metricDrainOutcome)
+	prometheus.MustRegister(metricNodesDrained)
+	prometheus.MustRegister(metricNodesTerminated)
+	prometheus.MustRegister(metricNodesDrainFailed)
+	prometheus.MustRegister(metricPolicyActions)
 
 	// metrics server
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		_, _ = fmt.Fprint(w, "ok\n")
 	})
+	http.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if amLeader() {
+			_, _ = fmt.Fprint(w, "leader\n")
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = fmt.Fprint(w, "standby\n")
+	})
 	http.Handle("/metrics", promhttp.Handler())
 	go func() {
 		err = http.ListenAndServe(":8080", nil)
@@ -133,17 +155,36 @@ func main() {
 
 	reaperNamespaces := namespaces()
 
-	for {
-
-		reapPods(clientset, reaperNamespaces, maxReaperCount, evict, reapEvicted)
+	// A CronJob runs once and exits, so there's no point standing up a watch
+	// cache for it: run a single list-based pass and return. Otherwise
+	// run the pod/node informers, which reconcile off the watch stream
+	// instead of relisting every REAPER_INTERVAL_IN_SEC.
+	reapLoop := func(ctx context.Context) {
+		if runAsCronJob {
+			if amLeader() {
+				reapPods(clientset, reaperNamespaces, maxReaperCount, evict, reapEvicted)
+				reapNodes(clientset)
+			} else {
+				log.Infof("Not the leader, skipping this run")
+			}
+			return
+		}
 
-		reapNodes(clientset)
+		runReconcilers(ctx, config, clientset, reaperNamespaces, maxReaperCount, evict, reapEvicted)
+	}
 
+	if leaderElectEnabled() {
+		identity, err := os.Hostname()
+		if err != nil {
+			identity = leaderElectName()
+		}
 		if runAsCronJob {
-			break
+			runLeaderElectionOnce(clientset, identity, reapLoop)
+		} else {
+			runLeaderElection(clientset, identity, reapLoop)
 		}
-		log.Infof("Now sleeping for %d seconds", int(sleepDuration().Seconds()))
-		time.Sleep(sleepDuration())
+	} else {
+		reapLoop(context.Background())
 	}
 }
 
@@ -242,35 +283,26 @@ func reapPods(clientset *kubernetes.Clientset, reaperNamespaces []string, maxRea
 		log.Infof("Checking %d pods in namespace %s\n", len(pods.Items), ns)
 		podsTracking := 0
 		podsKilled := 0
+		var expired []v1.Pod
 
 		for _, v := range pods.Items {
+			if _, ok := v.Annotations[preventReapAnnotation()]; ok {
+				log.Debugf("pod %s : has %s annotation, skipping\n", v.Name, preventReapAnnotation())
+				metricPodsReaped.WithLabelValues(ns, "skipped: prevent-reap").Inc()
+				continue
+			}
+
 			if val, ok := v.Annotations[lifetimeAnnotation]; ok {
 				log.Debugf("pod %s : Found annotation %s with value %s\n", v.Name, lifetimeAnnotation, val)
 				podsTracking++
 				lifetime, _ := time.ParseDuration(val)
 				if lifetime == 0 {
 					log.Debugf("pod %s : provided value %s is incorrect\n", v.Name, val)
-				} else if podsKilled < maxReaperCount {
+				} else if len(expired) < maxReaperCount {
 					log.Debugf("pod %s : %s\n", v.Name, v.CreationTimestamp)
 					currentLifetime := time.Since(v.CreationTimestamp.Time)
 					if currentLifetime > lifetime {
-						var err error
-						if evict {
-							log.Infof("pod %s : pod is past its lifetime and will be evicted\n", v.Name)
-							err = clientset.CoreV1().Pods(v.Namespace).Evict(context.TODO(), &policyv1.Eviction{
-								ObjectMeta:    metav1.ObjectMeta{Namespace: v.Namespace, Name: v.Name},
-								DeleteOptions: &metav1.DeleteOptions{},
-							})
-						} else {
-							log.Infof("pod %s : pod is past its lifetime and will be killed.\n", v.Name)
-							err = clientset.CoreV1().Pods(v.Namespace).Delete(context.TODO(), v.Name, metav1.DeleteOptions{})
-						}
-						if err != nil {
-							log.Infof("unable to reap pod %s : %s", v.Name, err.Error())
-						} else {
-							log.Infof("pod %s : pod reaped.\n", v.Name)
-							podsKilled++
-						}
+						expired = append(expired, v)
 					}
 				} else {
 					log.Debugf("pod %s : max %d pods killed\n", v.Name, maxReaperCount)
@@ -279,6 +311,7 @@ func reapPods(clientset *kubernetes.Clientset, reaperNamespaces []string, maxRea
 
 			if reapEvicted && strings.Contains(v.Status.Reason, "Evicted") {
 				log.Debugf("pod %s : pod is evicted and needs to be deleted", v.Name)
+				markDisruptionTarget(clientset, v, reasonEvictedCleanup, "")
 				err := clientset.CoreV1().Pods(v.Namespace).Delete(context.TODO(), v.Name, metav1.DeleteOptions{})
 				if err != nil {
 					panic(err.Error())
@@ -288,6 +321,23 @@ func reapPods(clientset *kubernetes.Clientset, reaperNamespaces []string, maxRea
 			}
 		}
 
+		if evict {
+			log.Infof("pod %s : pods past their lifetime will be drained\n", ns)
+			podsKilled += drainPods(clientset, expired, reasonLifetimeExpired, "")
+		} else {
+			for _, v := range expired {
+				log.Infof("pod %s : pod is past its lifetime and will be killed.\n", v.Name)
+				markDisruptionTarget(clientset, v, reasonLifetimeExpired, "")
+				err := clientset.CoreV1().Pods(v.Namespace).Delete(context.TODO(), v.Name, metav1.DeleteOptions{})
+				if err != nil {
+					log.Infof("unable to reap pod %s : %s", v.Name, err.Error())
+				} else {
+					log.Infof("pod %s : pod reaped.\n", v.Name)
+					podsKilled++
+				}
+			}
+		}
+
 		log.Infof("Killed %d Old/Evicted Pods.", podsKilled)
 		metricPods.WithLabelValues(ns, "ignoring").Set(float64(len(pods.Items) - podsTracking))
 		metricPods.WithLabelValues(ns, "tracking").Set(float64(podsTracking))
@@ -365,4 +415,31 @@ func reapNodes(clientset *kubernetes.Clientset) {
 		}
 		log.Debugf("\nDisable node %v", node.Name)
 	}
+
+	// cordon, drain, and optionally terminate expired spot nodes, grouped by
+	// node group so MAX_NODES_DRAIN_PARALLEL can be enforced per group.
+	// Nodes are not skipped just because they're already cordoned: a node
+	// left Unschedulable by a prior pass whose drain timed out or whose
+	// removeNode call failed needs to be retried here, not ignored forever.
+	expiredByGroup := make(map[string][]v1.Node)
+	for _, node := range nodes.Items {
+		if time.Since(node.CreationTimestamp.Time) < lifetime {
+			continue
+		}
+		var spot bool
+		var nodeGroup string
+		for k, v := range node.Labels {
+			if k == "node-lifecycle" && v == "spot" {
+				spot = true
+			}
+			if k == "alpha.eksctl.io/nodegroup-name" {
+				nodeGroup = v
+			}
+		}
+		if !spot {
+			continue
+		}
+		expiredByGroup[nodeGroup] = append(expiredByGroup[nodeGroup], node)
+	}
+	drainExpiredNodes(clientset, expiredByGroup)
 }
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/cloudflare/cfssl/log"
+	"github.com/prometheus/client_golang/prometheus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var (
+	metricNodesDrained = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "node_reaper_drained",
+			Help: "Number of expired nodes successfully drained.",
+		},
+		[]string{"nodegroup"},
+	)
+	metricNodesTerminated = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "node_reaper_terminated",
+			Help: "Number of expired nodes removed from the cluster.",
+		},
+		[]string{"nodegroup"},
+	)
+	metricNodesDrainFailed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "node_reaper_drain_failed",
+			Help: "Number of expired nodes that could not be drained in time.",
+		},
+		[]string{"nodegroup"},
+	)
+)
+
+func nodeTerminate() bool {
+	if val, ok := os.LookupEnv("NODE_TERMINATE"); ok {
+		boolVal, err := strconv.ParseBool(val)
+		if err == nil {
+			return boolVal
+		}
+	}
+	return false
+}
+
+func nodeDrainTimeout() time.Duration {
+	i, err := strconv.Atoi(os.Getenv("NODE_DRAIN_TIMEOUT"))
+	if err != nil {
+		i = 300
+	}
+	return time.Duration(i) * time.Second
+}
+
+func maxNodesDrainParallel() int {
+	i, err := strconv.Atoi(os.Getenv("MAX_NODES_DRAIN_PARALLEL"))
+	if err != nil || i <= 0 {
+		i = 1
+	}
+	return i
+}
+
+// NodeTerminator removes the cloud instance backing a drained node.
+// Implementations are selected by the node's provider ID scheme, so new
+// cloud providers can be added without touching the drain pipeline itself.
+type NodeTerminator interface {
+	Terminate(providerID string) error
+}
+
+func terminatorFor(providerID string) NodeTerminator {
+	if strings.HasPrefix(providerID, "aws://") {
+		return &awsTerminator{}
+	}
+	return nil
+}
+
+type awsTerminator struct{}
+
+func (t *awsTerminator) Terminate(providerID string) error {
+	instanceID, err := parseAWSInstanceID(providerID)
+	if err != nil {
+		return err
+	}
+	sess, err := session.NewSession()
+	if err != nil {
+		return err
+	}
+	_, err = ec2.New(sess).TerminateInstances(&ec2.TerminateInstancesInput{
+		InstanceIds: []*string{aws.String(instanceID)},
+	})
+	return err
+}
+
+// parseAWSInstanceID extracts the instance ID from a provider ID of the form
+// "aws:///<az>/<instance-id>".
+func parseAWSInstanceID(providerID string) (string, error) {
+	parts := strings.Split(strings.TrimPrefix(providerID, "aws://"), "/")
+	instanceID := parts[len(parts)-1]
+	if instanceID == "" {
+		return "", fmt.Errorf("unable to parse instance id from provider ID %q", providerID)
+	}
+	return instanceID, nil
+}
+
+func cordonNode(clientset *kubernetes.Clientset, node v1.Node) error {
+	node.Spec.Unschedulable = true
+	_, err := clientset.CoreV1().Nodes().Update(context.TODO(), &node, metav1.UpdateOptions{})
+	return err
+}
+
+// drainNode evacuates the node's pods using the same PDB-aware drain routine
+// and skip filters (drainSkipReason) used for expired pods, bounded by
+// NODE_DRAIN_TIMEOUT so a single stuck pod can't block the whole rotation.
+// It reports true only if every pod not skipped was evicted or deleted.
+func drainNode(clientset *kubernetes.Clientset, node v1.Node) bool {
+	pods, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{
+		FieldSelector: fmt.Sprintf("spec.nodeName=%s", node.Name),
+	})
+	if err != nil {
+		log.Errorf("node %s : failed to list pods for drain: %s\n", node.Name, err.Error())
+		return false
+	}
+
+	toDrain := 0
+	for _, pod := range pods.Items {
+		if _, skip := drainSkipReason(pod); !skip {
+			toDrain++
+		}
+	}
+
+	done := make(chan int, 1)
+	go func() {
+		done <- drainPods(clientset, pods.Items, reasonNodeDrain, "")
+	}()
+
+	select {
+	case drained := <-done:
+		if drained < toDrain {
+			log.Errorf("node %s : %d of %d pods could not be drained\n", node.Name, toDrain-drained, toDrain)
+			return false
+		}
+		return true
+	case <-time.After(nodeDrainTimeout()):
+		log.Errorf("node %s : drain timed out after %s\n", node.Name, nodeDrainTimeout())
+		return false
+	}
+}
+
+// removeNode deletes the Node object, or terminates the underlying instance
+// via a pluggable cloud terminator when NODE_TERMINATE is set.
+func removeNode(clientset *kubernetes.Clientset, node v1.Node, nodeGroup string) {
+	if nodeTerminate() {
+		if terminator := terminatorFor(node.Spec.ProviderID); terminator != nil {
+			if err := terminator.Terminate(node.Spec.ProviderID); err != nil {
+				log.Errorf("node %s : failed to terminate instance: %s\n", node.Name, err.Error())
+				return
+			}
+			log.Infof("node %s : instance terminated\n", node.Name)
+			metricNodesTerminated.WithLabelValues(nodeGroup).Inc()
+			return
+		}
+		log.Infof("node %s : no terminator for provider ID %s, falling back to deleting the node object\n", node.Name, node.Spec.ProviderID)
+	}
+
+	if err := clientset.CoreV1().Nodes().Delete(context.TODO(), node.Name, metav1.DeleteOptions{}); err != nil {
+		log.Errorf("node %s : failed to delete node object: %s\n", node.Name, err.Error())
+		return
+	}
+	log.Infof("node %s : node object deleted\n", node.Name)
+	metricNodesTerminated.WithLabelValues(nodeGroup).Inc()
+}
+
+// drainExpiredNodes cordons, drains, and removes every expired spot node,
+// capping concurrency per node group at MAX_NODES_DRAIN_PARALLEL so a whole
+// node group doesn't roll at once.
+func drainExpiredNodes(clientset *kubernetes.Clientset, nodesByGroup map[string][]v1.Node) {
+	var wg sync.WaitGroup
+	for nodeGroup, nodes := range nodesByGroup {
+		nodeGroup, nodes := nodeGroup, nodes
+		sem := make(chan struct{}, maxNodesDrainParallel())
+		for _, node := range nodes {
+			node := node
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				log.Infof("node %s : cordoning\n", node.Name)
+				if err := cordonNode(clientset, node); err != nil {
+					log.Errorf("node %s : failed to cordon: %s\n", node.Name, err.Error())
+					metricNodesDrainFailed.WithLabelValues(nodeGroup).Inc()
+					return
+				}
+
+				if !drainNode(clientset, node) {
+					metricNodesDrainFailed.WithLabelValues(nodeGroup).Inc()
+					return
+				}
+				metricNodesDrained.WithLabelValues(nodeGroup).Inc()
+
+				removeNode(clientset, node, nodeGroup)
+			}()
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestParseAWSInstanceID(t *testing.T) {
+	cases := []struct {
+		name       string
+		providerID string
+		want       string
+		wantErr    bool
+	}{
+		{
+			name:       "well-formed provider ID",
+			providerID: "aws:///us-east-1a/i-0123456789abcdef0",
+			want:       "i-0123456789abcdef0",
+		},
+		{
+			name:       "missing instance id",
+			providerID: "aws:///us-east-1a/",
+			wantErr:    true,
+		},
+		{
+			name:       "empty provider id",
+			providerID: "",
+			wantErr:    true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseAWSInstanceID(tc.providerID)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("parseAWSInstanceID(%q) = %q, nil, want an error", tc.providerID, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseAWSInstanceID(%q) returned unexpected error: %s", tc.providerID, err)
+			}
+			if got != tc.want {
+				t.Errorf("parseAWSInstanceID(%q) = %q, want %q", tc.providerID, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cfssl/log"
+	"github.com/prometheus/client_golang/prometheus"
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// reaperPolicyGVR identifies the namespaced ReaperPolicy CRD that lets
+// platform teams govern reaping centrally instead of asking every workload
+// owner to annotate their own pods.
+var reaperPolicyGVR = schema.GroupVersionResource{
+	Group:    "pod-reaper.io",
+	Version:  "v1alpha1",
+	Resource: "reaperpolicies",
+}
+
+func reaperPolicyEnabled() bool {
+	if val, ok := os.LookupEnv("REAPER_POLICY_ENABLED"); ok {
+		boolVal, err := strconv.ParseBool(val)
+		if err == nil {
+			return boolVal
+		}
+	}
+	return false
+}
+
+// ReaperPolicySpec mirrors the ReaperPolicy CRD's spec. It is decoded from
+// unstructured objects rather than through a generated clientset, since
+// pod-reaper has no other use for one.
+type ReaperPolicySpec struct {
+	Selector            metav1.LabelSelector `json:"selector"`
+	MaxAge              string               `json:"maxAge"`
+	MaxAgeJitterPercent int                  `json:"maxAgeJitterPercent,omitempty"`
+	Action              string               `json:"action"`
+	MaxConcurrent       int                  `json:"maxConcurrent,omitempty"`
+	Schedule            []ReaperPolicyWindow `json:"schedule,omitempty"`
+	DryRun              bool                 `json:"dryRun,omitempty"`
+}
+
+// ReaperPolicyWindow is a UTC time-of-day window modeled on kured's
+// --time-window: a policy only reaps pods while now falls inside one of them.
+type ReaperPolicyWindow struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+var metricPolicyActions = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "pod_reaper_policy_actions",
+		Help: "Number of pods acted on by a ReaperPolicy, by policy, action and outcome.",
+	},
+	[]string{"policy", "action", "outcome"},
+)
+
+type reaperPolicy struct {
+	namespace string
+	name      string
+	spec      ReaperPolicySpec
+	selector  labels.Selector
+	inFlight  chan struct{}
+}
+
+func (p *reaperPolicy) key() string {
+	return p.namespace + "/" + p.name
+}
+
+// ReaperPolicyController watches ReaperPolicy objects and the pods they
+// select, enforcing each policy's maxAge/action/schedule in addition to (or
+// instead of) the pod.kubernetes.io/lifetime annotation.
+type ReaperPolicyController struct {
+	clientset      *kubernetes.Clientset
+	policyInformer cache.SharedIndexInformer
+	podInformer    cache.SharedIndexInformer
+	queue          workqueue.RateLimitingInterface
+
+	mu       sync.RWMutex
+	policies map[string]*reaperPolicy
+}
+
+func newReaperPolicyController(clientset *kubernetes.Clientset, dynamicClient dynamic.Interface, resync time.Duration) *ReaperPolicyController {
+	policyFactory := dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, resync)
+	policyInformer := policyFactory.ForResource(reaperPolicyGVR).Informer()
+
+	podFactory := informers.NewSharedInformerFactory(clientset, resync)
+	podInformer := podFactory.Core().V1().Pods().Informer()
+
+	rc := &ReaperPolicyController{
+		clientset:      clientset,
+		policyInformer: policyInformer,
+		podInformer:    podInformer,
+		queue:          workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		policies:       map[string]*reaperPolicy{},
+	}
+
+	policyInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    rc.storePolicy,
+		UpdateFunc: func(_, newObj interface{}) { rc.storePolicy(newObj) },
+		DeleteFunc: rc.removePolicy,
+	})
+
+	podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    rc.enqueuePod,
+		UpdateFunc: func(_, newObj interface{}) { rc.enqueuePod(newObj) },
+	})
+
+	return rc
+}
+
+func (rc *ReaperPolicyController) storePolicy(obj interface{}) {
+	policy, err := decodeReaperPolicy(obj)
+	if err != nil {
+		log.Errorf("reaperpolicy : failed to decode policy: %s\n", err.Error())
+		return
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(&policy.spec.Selector)
+	if err != nil {
+		log.Errorf("reaperpolicy %s : invalid selector: %s\n", policy.key(), err.Error())
+		return
+	}
+	policy.selector = selector
+
+	maxConcurrent := policy.spec.MaxConcurrent
+	if maxConcurrent <= 0 {
+		maxConcurrent = 1
+	}
+	policy.inFlight = make(chan struct{}, maxConcurrent)
+
+	rc.mu.Lock()
+	rc.policies[policy.key()] = policy
+	rc.mu.Unlock()
+
+	log.Infof("reaperpolicy %s : loaded (action=%s, maxAge=%s)\n", policy.key(), policy.spec.Action, policy.spec.MaxAge)
+	rc.requeueMatchingPods(policy)
+}
+
+func (rc *ReaperPolicyController) removePolicy(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	policy, err := decodeReaperPolicy(obj)
+	if err != nil {
+		return
+	}
+	rc.mu.Lock()
+	delete(rc.policies, policy.key())
+	rc.mu.Unlock()
+	log.Infof("reaperpolicy %s : removed\n", policy.key())
+}
+
+// requeueMatchingPods schedules every currently cached pod that a
+// newly-loaded or updated policy selects, so changes take effect without
+// waiting for the next pod event.
+func (rc *ReaperPolicyController) requeueMatchingPods(policy *reaperPolicy) {
+	for _, obj := range rc.podInformer.GetStore().List() {
+		pod, ok := obj.(*v1.Pod)
+		if !ok || pod.Namespace != policy.namespace {
+			continue
+		}
+		if !policy.selector.Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+		rc.enqueuePod(pod)
+	}
+}
+
+func (rc *ReaperPolicyController) enqueuePod(obj interface{}) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		return
+	}
+	key, err := cache.MetaNamespaceKeyFunc(pod)
+	if err != nil {
+		return
+	}
+	rc.queue.Add(key)
+}
+
+func (rc *ReaperPolicyController) matchingPolicies(pod *v1.Pod) []*reaperPolicy {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+
+	var matched []*reaperPolicy
+	for _, policy := range rc.policies {
+		if policy.namespace != pod.Namespace {
+			continue
+		}
+		if policy.selector.Matches(labels.Set(pod.Labels)) {
+			matched = append(matched, policy)
+		}
+	}
+	return matched
+}
+
+func (rc *ReaperPolicyController) Run(ctx context.Context) {
+	defer rc.queue.ShutDown()
+
+	go rc.policyInformer.Run(ctx.Done())
+	go rc.podInformer.Run(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), rc.policyInformer.HasSynced, rc.podInformer.HasSynced) {
+		log.Errorf("reaperpolicy controller cache failed to sync")
+		return
+	}
+
+	// reconcile can block inside applyPolicyAction waiting on a PDB, so a
+	// single worker would let one blocked pod stall every other policy's
+	// reconciles. Run as many workers as pods are allowed to drain in
+	// parallel, the same bound each policy's own MaxConcurrent is relative to.
+	for i := 0; i < podDrainConcurrency(); i++ {
+		go wait.Until(rc.runWorker, time.Second, ctx.Done())
+	}
+	<-ctx.Done()
+}
+
+func (rc *ReaperPolicyController) runWorker() {
+	for rc.processNextItem() {
+	}
+}
+
+func (rc *ReaperPolicyController) processNextItem() bool {
+	key, shutdown := rc.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer rc.queue.Done(key)
+
+	requeueAfter, err := rc.reconcile(key.(string))
+	if err != nil {
+		log.Infof("reaperpolicy : unable to reconcile pod %s : %s", key, err.Error())
+		rc.queue.AddRateLimited(key)
+		return true
+	}
+	rc.queue.Forget(key)
+	if requeueAfter > 0 {
+		rc.queue.AddAfter(key, requeueAfter)
+	}
+	return true
+}
+
+// reconcile evaluates every policy matching the pod and, if one is due,
+// applies its action. It returns a duration after which the pod should be
+// re-checked (e.g. because it is not old enough yet, or outside its
+// schedule window).
+func (rc *ReaperPolicyController) reconcile(key string) (time.Duration, error) {
+	obj, exists, err := rc.podInformer.GetIndexer().GetByKey(key)
+	if err != nil || !exists {
+		return 0, err
+	}
+	pod := obj.(*v1.Pod).DeepCopy()
+
+	if _, ok := pod.Annotations[preventReapAnnotation()]; ok {
+		return 0, nil
+	}
+
+	var nextCheck time.Duration
+	for _, policy := range rc.matchingPolicies(pod) {
+		due, delay := policyDue(policy, pod)
+		if !due {
+			if nextCheck == 0 || delay < nextCheck {
+				nextCheck = delay
+			}
+			continue
+		}
+
+		select {
+		case policy.inFlight <- struct{}{}:
+		default:
+			// at MaxConcurrent for this policy already; try again shortly.
+			if nextCheck == 0 || time.Second < nextCheck {
+				nextCheck = time.Second
+			}
+			continue
+		}
+
+		func() {
+			defer func() { <-policy.inFlight }()
+
+			if policy.spec.DryRun {
+				log.Infof("reaperpolicy %s : pod %s would be %sd (dry run)\n", policy.key(), pod.Name, policy.spec.Action)
+				metricPolicyActions.WithLabelValues(policy.key(), policy.spec.Action, "dry_run").Inc()
+				return
+			}
+
+			outcome := applyPolicyAction(rc.clientset, *pod, policy.spec.Action, policy.key())
+			log.Infof("reaperpolicy %s : pod %s : %s\n", policy.key(), pod.Name, outcome)
+			metricPolicyActions.WithLabelValues(policy.key(), policy.spec.Action, outcome).Inc()
+		}()
+	}
+
+	return nextCheck, nil
+}
+
+// policyDue reports whether a policy's maxAge (with jitter) has elapsed for
+// pod and it falls inside the policy's schedule window. When not due, it
+// also returns how long to wait before checking again.
+func policyDue(policy *reaperPolicy, pod *v1.Pod) (bool, time.Duration) {
+	maxAge, err := time.ParseDuration(policy.spec.MaxAge)
+	if err != nil {
+		return false, time.Minute
+	}
+	maxAge = jitteredMaxAge(maxAge, policy.spec.MaxAgeJitterPercent, string(pod.UID))
+
+	if age := time.Since(pod.CreationTimestamp.Time); age < maxAge {
+		return false, maxAge - age
+	}
+
+	if !withinSchedule(policy.spec.Schedule, time.Now()) {
+		return false, time.Minute
+	}
+
+	return true, 0
+}
+
+// jitteredMaxAge perturbs base by up to +/-jitterPercent%, deterministically
+// per pod (seeded by UID) so repeated reconciles of the same pod don't keep
+// shifting its deadline and so pods don't all expire in the same instant.
+func jitteredMaxAge(base time.Duration, jitterPercent int, podUID string) time.Duration {
+	if jitterPercent <= 0 {
+		return base
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(podUID))
+	frac := float64(h.Sum32()%10000) / 10000.0 // deterministic pseudo-random in [0,1)
+	delta := float64(base) * (float64(jitterPercent) / 100.0) * (frac*2 - 1)
+	return base + time.Duration(delta)
+}
+
+// withinSchedule reports whether now falls inside one of the UTC
+// time-of-day windows. No windows means always-on.
+func withinSchedule(windows []ReaperPolicyWindow, now time.Time) bool {
+	if len(windows) == 0 {
+		return true
+	}
+	nowMin := now.UTC().Hour()*60 + now.UTC().Minute()
+	for _, w := range windows {
+		start, errStart := parseHHMM(w.Start)
+		end, errEnd := parseHHMM(w.End)
+		if errStart != nil || errEnd != nil {
+			continue
+		}
+		if start <= end {
+			if nowMin >= start && nowMin < end {
+				return true
+			}
+		} else if nowMin >= start || nowMin < end {
+			return true
+		}
+	}
+	return false
+}
+
+func parseHHMM(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// applyPolicyAction carries out a policy's configured action against pod,
+// reusing the same PDB-aware drain routine the lifetime-annotation path uses
+// for "drain", and records a DisruptionTarget condition attributing the
+// disruption to policyName before acting on the pod.
+func applyPolicyAction(clientset *kubernetes.Clientset, pod v1.Pod, action string, policyName string) string {
+	markDisruptionTarget(clientset, pod, reasonReaperPolicy, policyName)
+
+	switch action {
+	case "evict":
+		err := clientset.CoreV1().Pods(pod.Namespace).EvictV1(context.TODO(), &policyv1.Eviction{
+			ObjectMeta: metav1.ObjectMeta{Namespace: pod.Namespace, Name: pod.Name},
+		})
+		if err != nil {
+			return "error"
+		}
+		return "evicted"
+	case "drain":
+		return drainPod(clientset, pod, reasonReaperPolicy, policyName)
+	default:
+		if err := clientset.CoreV1().Pods(pod.Namespace).Delete(context.TODO(), pod.Name, metav1.DeleteOptions{}); err != nil {
+			return "error"
+		}
+		return "deleted"
+	}
+}
+
+// decodeReaperPolicy converts an informer object (an
+// *unstructured.Unstructured) into a reaperPolicy.
+func decodeReaperPolicy(obj interface{}) (*reaperPolicy, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("reaperpolicy : unexpected informer object type %T", obj)
+	}
+
+	var spec ReaperPolicySpec
+	specMap, found, err := unstructured.NestedMap(u.Object, "spec")
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(specMap, &spec); err != nil {
+			return nil, err
+		}
+	}
+
+	return &reaperPolicy{
+		namespace: u.GetNamespace(),
+		name:      u.GetName(),
+		spec:      spec,
+	}, nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestWithinSchedule(t *testing.T) {
+	cases := []struct {
+		name    string
+		windows []ReaperPolicyWindow
+		now     time.Time
+		want    bool
+	}{
+		{
+			name:    "no windows means always on",
+			windows: nil,
+			now:     time.Date(2026, 7, 30, 3, 0, 0, 0, time.UTC),
+			want:    true,
+		},
+		{
+			name:    "inside a same-day window",
+			windows: []ReaperPolicyWindow{{Start: "09:00", End: "17:00"}},
+			now:     time.Date(2026, 7, 30, 12, 0, 0, 0, time.UTC),
+			want:    true,
+		},
+		{
+			name:    "outside a same-day window",
+			windows: []ReaperPolicyWindow{{Start: "09:00", End: "17:00"}},
+			now:     time.Date(2026, 7, 30, 20, 0, 0, 0, time.UTC),
+			want:    false,
+		},
+		{
+			name:    "inside a midnight-wrapping window, late side",
+			windows: []ReaperPolicyWindow{{Start: "22:00", End: "06:00"}},
+			now:     time.Date(2026, 7, 30, 23, 30, 0, 0, time.UTC),
+			want:    true,
+		},
+		{
+			name:    "inside a midnight-wrapping window, early side",
+			windows: []ReaperPolicyWindow{{Start: "22:00", End: "06:00"}},
+			now:     time.Date(2026, 7, 30, 2, 0, 0, 0, time.UTC),
+			want:    true,
+		},
+		{
+			name:    "outside a midnight-wrapping window",
+			windows: []ReaperPolicyWindow{{Start: "22:00", End: "06:00"}},
+			now:     time.Date(2026, 7, 30, 12, 0, 0, 0, time.UTC),
+			want:    false,
+		},
+		{
+			name:    "unparseable window is ignored, not treated as always-on",
+			windows: []ReaperPolicyWindow{{Start: "garbage", End: "06:00"}},
+			now:     time.Date(2026, 7, 30, 2, 0, 0, 0, time.UTC),
+			want:    false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := withinSchedule(tc.windows, tc.now); got != tc.want {
+				t.Errorf("withinSchedule(%v, %v) = %v, want %v", tc.windows, tc.now, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestJitteredMaxAge(t *testing.T) {
+	base := time.Hour
+
+	if got := jitteredMaxAge(base, 0, "pod-a"); got != base {
+		t.Errorf("jitteredMaxAge with 0%% jitter = %v, want unchanged %v", got, base)
+	}
+
+	got := jitteredMaxAge(base, 20, "pod-a")
+	min, max := time.Duration(float64(base)*0.8), time.Duration(float64(base)*1.2)
+	if got < min || got > max {
+		t.Errorf("jitteredMaxAge(%v, 20, ...) = %v, want within [%v, %v]", base, got, min, max)
+	}
+
+	if a, b := jitteredMaxAge(base, 20, "pod-a"), jitteredMaxAge(base, 20, "pod-a"); a != b {
+		t.Errorf("jitteredMaxAge is not deterministic for the same UID: %v != %v", a, b)
+	}
+
+	if a, b := jitteredMaxAge(base, 20, "pod-a"), jitteredMaxAge(base, 20, "pod-b"); a == b {
+		t.Errorf("jitteredMaxAge(%q) and jitteredMaxAge(%q) collided at %v; expected different UIDs to usually differ", "pod-a", "pod-b", a)
+	}
+}
+
+func TestPolicyDue(t *testing.T) {
+	now := time.Now()
+
+	t.Run("invalid maxAge defers a minute", func(t *testing.T) {
+		policy := &reaperPolicy{spec: ReaperPolicySpec{MaxAge: "not-a-duration"}}
+		pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(now)}}
+
+		due, wait := policyDue(policy, pod)
+		if due || wait != time.Minute {
+			t.Errorf("policyDue() = (%v, %v), want (false, %v)", due, wait, time.Minute)
+		}
+	})
+
+	t.Run("pod younger than maxAge is not due", func(t *testing.T) {
+		policy := &reaperPolicy{spec: ReaperPolicySpec{MaxAge: "1h"}}
+		pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			UID:               types.UID("pod-a"),
+			CreationTimestamp: metav1.NewTime(now),
+		}}
+
+		due, wait := policyDue(policy, pod)
+		if due {
+			t.Errorf("policyDue() = (%v, %v), want not due for a fresh pod", due, wait)
+		}
+		if wait <= 0 || wait > time.Hour {
+			t.Errorf("policyDue() wait = %v, want within (0, 1h]", wait)
+		}
+	})
+
+	t.Run("pod past maxAge outside schedule is not due", func(t *testing.T) {
+		policy := &reaperPolicy{spec: ReaperPolicySpec{
+			MaxAge:   "1h",
+			Schedule: []ReaperPolicyWindow{{Start: "00:00", End: "00:01"}},
+		}}
+		pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			UID:               types.UID("pod-a"),
+			CreationTimestamp: metav1.NewTime(now.Add(-2 * time.Hour)),
+		}}
+
+		due, wait := policyDue(policy, pod)
+		if due || wait != time.Minute {
+			t.Errorf("policyDue() = (%v, %v), want (false, %v) outside the schedule window", due, wait, time.Minute)
+		}
+	})
+
+	t.Run("pod past maxAge with no schedule is due", func(t *testing.T) {
+		policy := &reaperPolicy{spec: ReaperPolicySpec{MaxAge: "1h"}}
+		pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			UID:               types.UID("pod-a"),
+			CreationTimestamp: metav1.NewTime(now.Add(-2 * time.Hour)),
+		}}
+
+		due, wait := policyDue(policy, pod)
+		if !due || wait != 0 {
+			t.Errorf("policyDue() = (%v, %v), want (true, 0)", due, wait)
+		}
+	})
+}